@@ -0,0 +1,193 @@
+package resolver
+
+import (
+	"math/rand"
+	"net/netip"
+
+	"github.com/metacubex/mihomo/component/trie"
+
+	D "github.com/miekg/dns"
+)
+
+// DefaultHostTTL is the TTL handed out for a hosts entry that doesn't
+// specify one of its own.
+const DefaultHostTTL = uint32(60)
+
+// HostValue is one resolved `hosts:` entry. It is either a fixed set of A/
+// AAAA addresses (one picked at random by RandIP when there is more than
+// one) or a CNAME target that must be flattened against the configured
+// nameservers before it can answer a query. TTL is the entry's own TTL
+// override; zero means "use DefaultHostTTL".
+type HostValue struct {
+	Addrs []netip.Addr
+	CNAME string
+	TTL   uint32
+}
+
+// NewHostValue builds a HostValue for one or more literal A/AAAA addresses.
+func NewHostValue(addrs []netip.Addr) HostValue {
+	return HostValue{Addrs: addrs, TTL: DefaultHostTTL}
+}
+
+// NewHostCNAME builds a HostValue that points at another name, to be
+// flattened at resolve time.
+func NewHostCNAME(target string, ttl uint32) HostValue {
+	if ttl == 0 {
+		ttl = DefaultHostTTL
+	}
+	return HostValue{CNAME: target, TTL: ttl}
+}
+
+// WithTTL returns a copy of v with its TTL overridden.
+func (v HostValue) WithTTL(ttl uint32) HostValue {
+	v.TTL = ttl
+	return v
+}
+
+// IsDomain reports whether v is a CNAME that still needs flattening.
+func (v HostValue) IsDomain() bool {
+	return v.CNAME != ""
+}
+
+// RandIP returns one address from v, picked uniformly at random on each call
+// so that repeated lookups spread over a multi-address entry; it does not
+// rotate through the addresses in a fixed round-robin order. ok is false for
+// a CNAME entry or one with no addresses.
+func (v HostValue) RandIP() (addr netip.Addr, ok bool) {
+	if len(v.Addrs) == 0 {
+		return netip.Addr{}, false
+	}
+	if len(v.Addrs) == 1 {
+		return v.Addrs[0], true
+	}
+	return v.Addrs[rand.Intn(len(v.Addrs))], true
+}
+
+// ttlOrDefault returns v.TTL, or DefaultHostTTL if v didn't set one.
+func (v HostValue) ttlOrDefault() uint32 {
+	if v.TTL == 0 {
+		return DefaultHostTTL
+	}
+	return v.TTL
+}
+
+// maxCNAMEDepth bounds CNAME flattening so a misconfigured chain (or a
+// cycle a naive walk would miss) can't loop forever.
+const maxCNAMEDepth = 8
+
+// Hosts wraps the `hosts:` domain trie, resolving CNAME chains to their
+// final address set.
+type Hosts struct {
+	tree *trie.DomainTrie[HostValue]
+}
+
+// NewHosts wraps tree, which may be nil (an empty host table).
+func NewHosts(tree *trie.DomainTrie[HostValue]) *Hosts {
+	return &Hosts{tree: tree}
+}
+
+// IsExist reports whether domain has a hosts entry, without flattening it.
+func (h *Hosts) IsExist(domain string) bool {
+	if h == nil || h.tree == nil {
+		return false
+	}
+	return h.tree.Search(domain) != nil
+}
+
+// Search looks up domain, following CNAME entries within this trie up to
+// maxCNAMEDepth hops and stopping early on a cycle. It does not reach out to
+// any nameserver: a CNAME target that isn't itself in the hosts trie is
+// returned as-is (IsDomain() true) for the caller to resolve externally via
+// the configured nameservers, per the `hosts-mapping-file`/`hosts:` docs.
+func (h *Hosts) Search(domain string) (HostValue, bool) {
+	if h == nil || h.tree == nil {
+		return HostValue{}, false
+	}
+
+	seen := make(map[string]bool, maxCNAMEDepth)
+	name := domain
+	var last HostValue
+	for depth := 0; depth < maxCNAMEDepth; depth++ {
+		node := h.tree.Search(name)
+		if node == nil {
+			if depth == 0 {
+				return HostValue{}, false
+			}
+			// CNAME target outside the hosts trie; hand the CNAME back
+			return last, true
+		}
+		v := node.Data()
+		if !v.IsDomain() {
+			return v, true
+		}
+		if seen[v.CNAME] {
+			// cycle within the hosts trie itself; surface the CNAME as-is
+			// rather than spinning forever
+			return v, true
+		}
+		seen[name] = true
+		last = v
+		name = v.CNAME
+	}
+
+	// chain too deep; return the last value found so the caller can still
+	// attempt external resolution of its CNAME target
+	node := h.tree.Search(name)
+	if node == nil {
+		return last, true
+	}
+	return node.Data(), true
+}
+
+// ToMsg builds a synthetic answer for fqdn/qType out of v's address set,
+// honoring v's TTL override (or DefaultHostTTL). It returns nil if v is a
+// still-unflattened CNAME or qType doesn't match any address in v (e.g. an
+// AAAA query against an entry with only A addresses).
+func (v HostValue) ToMsg(fqdn string, qType uint16) *D.Msg {
+	if v.IsDomain() {
+		return nil
+	}
+
+	msg := new(D.Msg)
+	ttl := v.ttlOrDefault()
+
+	for _, addr := range v.Addrs {
+		switch {
+		case qType == D.TypeA && addr.Is4():
+			msg.Answer = append(msg.Answer, &D.A{
+				Hdr: D.RR_Header{Name: fqdn, Rrtype: D.TypeA, Class: D.ClassINET, Ttl: ttl},
+				A:   addr.AsSlice(),
+			})
+		case qType == D.TypeAAAA && addr.Is6():
+			msg.Answer = append(msg.Answer, &D.AAAA{
+				Hdr:  D.RR_Header{Name: fqdn, Rrtype: D.TypeAAAA, Class: D.ClassINET, Ttl: ttl},
+				AAAA: addr.AsSlice(),
+			})
+		}
+	}
+
+	if len(msg.Answer) == 0 {
+		return nil
+	}
+	return msg
+}
+
+// LookupHosts is the seam meant for the DNS resolver/enhancer to consult
+// before falling through to the configured nameservers: it answers
+// fqdn/qType straight out of DefaultHosts when there's a non-CNAME hit,
+// synthesizing the response via HostValue.ToMsg. It returns ok=false both
+// when there's no hosts entry and when the entry is an unflattened CNAME
+// (DefaultHosts.Search already flattens chains that stay within the hosts
+// trie itself); in the CNAME case the caller is expected to resolve the
+// target itself via DefaultResolver and cache the result the same way it
+// would for any other upstream answer. Nothing in this package calls it yet
+// - the resolver/enhancer that owns the query path lives outside it.
+func LookupHosts(fqdn string, qType uint16) (*D.Msg, bool) {
+	v, ok := DefaultHosts.Search(fqdn)
+	if !ok || v.IsDomain() {
+		return nil, false
+	}
+
+	msg := v.ToMsg(fqdn, qType)
+	return msg, msg != nil
+}
@@ -0,0 +1,115 @@
+package sniffer
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/metacubex/mihomo/component/trie"
+	"github.com/metacubex/mihomo/constant/sniffer"
+)
+
+// PortRange is an inclusive [Start, End] TCP/UDP port range used to scope a
+// sniffer to specific destination ports.
+type PortRange struct {
+	Start uint16
+	End   uint16
+}
+
+func (r PortRange) contains(port uint16) bool {
+	return port >= r.Start && port <= r.End
+}
+
+// Config is the per-sniffer configuration produced from the `sniff:` YAML
+// block: which ports/source networks it applies to, how long to wait for a
+// handshake, and the override-destination list inverted by OverrideForce.
+type Config struct {
+	Ports    []PortRange
+	SrcCIDRs []netip.Prefix
+	Timeout  time.Duration
+	Override *trie.DomainTrie[bool]
+
+	// OverrideForce selects how Override is interpreted: when true, Override
+	// is an allow-list (force-domain) and only sniffed domains that match it
+	// replace the connection's destination; when false, Override is a
+	// deny-list (skip-domain) and sniffed domains that match it never replace
+	// the destination.
+	OverrideForce bool
+}
+
+func (c Config) matchesEndpoint(port uint16, src netip.Addr) bool {
+	if len(c.Ports) > 0 {
+		matched := false
+		for _, r := range c.Ports {
+			if r.contains(port) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(c.SrcCIDRs) > 0 {
+		matched := false
+		for _, cidr := range c.SrcCIDRs {
+			if cidr.Contains(src) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c Config) allows(domain string) bool {
+	if c.Override == nil {
+		return true
+	}
+
+	hit := c.Override.Search(domain) != nil
+	if c.OverrideForce {
+		return hit
+	}
+	return !hit
+}
+
+// stat tracks sniff attempts for one sniffer type, surfaced by the
+// /sniffer API endpoint.
+type stat struct {
+	hit  atomic.Uint64
+	miss atomic.Uint64
+}
+
+// Stats is the snapshot returned for a single sniffer type by Dispatcher.Stats.
+type Stats struct {
+	Hit  uint64 `json:"hit"`
+	Miss uint64 `json:"miss"`
+}
+
+func (d *Dispatcher) recordHit(proto sniffer.Type) {
+	if s, ok := d.stats[proto]; ok {
+		s.hit.Add(1)
+	}
+}
+
+func (d *Dispatcher) recordMiss(proto sniffer.Type) {
+	if s, ok := d.stats[proto]; ok {
+		s.miss.Add(1)
+	}
+}
+
+// Stats returns a point-in-time snapshot of sniffed/missed counts per
+// sniffer type.
+func (d *Dispatcher) Stats() map[sniffer.Type]Stats {
+	out := make(map[sniffer.Type]Stats, len(d.stats))
+	for proto, s := range d.stats {
+		out[proto] = Stats{Hit: s.hit.Load(), Miss: s.miss.Load()}
+	}
+	return out
+}
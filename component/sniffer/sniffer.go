@@ -0,0 +1,128 @@
+package sniffer
+
+import (
+	"time"
+
+	"github.com/metacubex/mihomo/component/trie"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/constant/sniffer"
+)
+
+const defaultSniffTimeout = 500 * time.Millisecond
+
+// Dispatcher decides, per connection, whether a sniffer should run and which
+// one, then tallies hit/miss stats surfaced by the /sniffer API endpoint.
+type Dispatcher struct {
+	enable          bool
+	forceDomain     *trie.DomainSet
+	skipDomain      *trie.DomainSet
+	forceDNSMapping bool
+	parsePureIP     bool
+
+	sniffers map[sniffer.Type]Config
+	stats    map[sniffer.Type]*stat
+}
+
+// NewCloseSnifferDispatcher returns a Dispatcher that never sniffs, used when
+// `sniff.enable` is false.
+func NewCloseSnifferDispatcher() (*Dispatcher, error) {
+	return &Dispatcher{enable: false}, nil
+}
+
+// NewSnifferDispatcher builds a Dispatcher from the `sniff:` config block.
+// snifferConfig carries, per sniffer type, the override-destination list
+// (interpreted as an allow-list when Config.OverrideForce is set and as a
+// deny-list otherwise), the port/source-network scope and the per-sniffer
+// timeout; entries with a zero Timeout fall back to defaultSniffTimeout.
+func NewSnifferDispatcher(
+	snifferConfig map[sniffer.Type]Config,
+	forceDomain, skipDomain *trie.DomainSet,
+	forceDNSMapping, parsePureIP bool,
+) (*Dispatcher, error) {
+	d := &Dispatcher{
+		enable:          true,
+		forceDomain:     forceDomain,
+		skipDomain:      skipDomain,
+		forceDNSMapping: forceDNSMapping,
+		parsePureIP:     parsePureIP,
+		sniffers:        make(map[sniffer.Type]Config, len(snifferConfig)),
+		stats:           make(map[sniffer.Type]*stat, len(snifferConfig)),
+	}
+
+	for proto, cfg := range snifferConfig {
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = defaultSniffTimeout
+		}
+		d.sniffers[proto] = cfg
+		d.stats[proto] = &stat{}
+	}
+
+	return d, nil
+}
+
+// Enable reports whether this dispatcher sniffs at all.
+func (d *Dispatcher) Enable() bool {
+	return d != nil && d.enable
+}
+
+// ShouldSniff is the pre-sniff gate: it reports whether metadata falls
+// within proto's configured port range and source network, before any bytes
+// are inspected. The sniff loop must call this first and skip sniffing
+// entirely when it returns false, instead of sniffing every connection and
+// only suppressing the destination override afterwards.
+func (d *Dispatcher) ShouldSniff(proto sniffer.Type, metadata *C.Metadata) bool {
+	if !d.Enable() {
+		return false
+	}
+
+	cfg, ok := d.sniffers[proto]
+	if !ok {
+		return true
+	}
+
+	if !cfg.matchesEndpoint(metadata.DstPort, metadata.SrcIP) {
+		d.recordMiss(proto)
+		return false
+	}
+
+	return true
+}
+
+// ShouldOverride decides whether a domain already sniffed for proto (set on
+// metadata.Host by the caller) should replace the connection's destination,
+// consulting the per-sniffer override-destination list before falling back
+// to the legacy global force-domain/skip-domain trie. Callers must have
+// already checked ShouldSniff; ShouldOverride does not re-check port/source
+// scope.
+func (d *Dispatcher) ShouldOverride(proto sniffer.Type, metadata *C.Metadata) bool {
+	if !d.Enable() {
+		return false
+	}
+
+	if cfg, ok := d.sniffers[proto]; ok && !cfg.allows(metadata.Host) {
+		d.recordMiss(proto)
+		return false
+	}
+
+	if d.forceDomain != nil && d.forceDomain.Has(metadata.Host) {
+		d.recordHit(proto)
+		return true
+	}
+
+	if d.skipDomain != nil && d.skipDomain.Has(metadata.Host) {
+		d.recordMiss(proto)
+		return false
+	}
+
+	d.recordHit(proto)
+	return true
+}
+
+// Timeout returns the configured sniff timeout for proto, or
+// defaultSniffTimeout if the sniffer wasn't configured with one.
+func (d *Dispatcher) Timeout(proto sniffer.Type) time.Duration {
+	if cfg, ok := d.sniffers[proto]; ok {
+		return cfg.Timeout
+	}
+	return defaultSniffTimeout
+}
@@ -0,0 +1,180 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	G "github.com/metacubex/mihomo/component/geodata"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
+)
+
+var (
+	// UpdatingGeo guards against overlapping geo database updates, whether
+	// triggered by the ticker or the /configs/geo API.
+	UpdatingGeo atomic.Bool
+
+	// ErrGetDatabaseUpdateSkip is returned by UpdateGeoDatabases when an
+	// update is already in flight.
+	ErrGetDatabaseUpdateSkip = errors.New("GeoIP, GeoSite, ASN database is updating, skip")
+
+	geoUpdateTicker *time.Ticker
+	geoUpdateDone   chan struct{}
+
+	geoURLs atomic.Value // geoURLSet
+)
+
+// geoURLSet is the GeoIP/GeoSite/ASN download URLs in effect, swapped
+// atomically by SetGeoURLs so a concurrent UpdateGeoDatabases (from the
+// ticker or a /configs/geo request) never reads a partially-updated set.
+type geoURLSet struct {
+	geoIP, geoSite, asn string
+}
+
+func init() {
+	geoURLs.Store(geoURLSet{geoIP: C.GeoIpUrl, geoSite: C.GeoSiteUrl, asn: C.ASNUrl})
+}
+
+// SetGeoURLs overrides the GeoIP/GeoSite/ASN download URLs used by
+// UpdateGeoDatabases, falling back to the existing value for any argument
+// left empty. It is called from executor.updateGeoAutoUpdate with the
+// `geo-auto-update` config section so those downloads can be repointed
+// without a rebuild.
+func SetGeoURLs(geoIP, geoSite, asn string) {
+	cur := geoURLs.Load().(geoURLSet)
+	if geoIP != "" {
+		cur.geoIP = geoIP
+	}
+	if geoSite != "" {
+		cur.geoSite = geoSite
+	}
+	if asn != "" {
+		cur.asn = asn
+	}
+	geoURLs.Store(cur)
+}
+
+// RegisterGeoUpdater (re)starts a background ticker that periodically
+// re-downloads the GeoIP/GeoSite/ASN databases and invokes onSuccess once
+// the on-disk databases have been swapped in. It is safe to call on every
+// config apply: the previous ticker is always stopped first, and passing a
+// non-positive interval (e.g. because geo-auto-update was turned off) just
+// leaves the updater stopped instead of starting a new one.
+func RegisterGeoUpdater(interval time.Duration, onSuccess func()) {
+	if geoUpdateTicker != nil {
+		geoUpdateTicker.Stop()
+		close(geoUpdateDone)
+		geoUpdateTicker = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	geoUpdateTicker = time.NewTicker(interval)
+	geoUpdateDone = make(chan struct{})
+	ticker := geoUpdateTicker
+	done := geoUpdateDone
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				err := UpdateGeoDatabases()
+				switch {
+				case err == nil:
+					onSuccess()
+				case errors.Is(err, ErrGetDatabaseUpdateSkip):
+					// an update is already running (e.g. triggered via the API); skip quietly
+				default:
+					log.Errorln("[GEO] auto update failed: %s", err.Error())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	log.Infoln("[GEO] auto update enabled, interval: %s", interval)
+}
+
+// UpdateGeoDatabases downloads the GeoIP, GeoSite and ASN databases to a
+// temporary file, verifies them, then atomically renames them into place.
+// It returns ErrGetDatabaseUpdateSkip if another update is already running.
+func UpdateGeoDatabases() error {
+	if !UpdatingGeo.CompareAndSwap(false, true) {
+		return ErrGetDatabaseUpdateSkip
+	}
+	defer UpdatingGeo.Store(false)
+
+	urls := geoURLs.Load().(geoURLSet)
+
+	if urls.geoIP != "" {
+		if err := updateOne(urls.geoIP, C.Path.GeoIP()); err != nil {
+			return fmt.Errorf("update GeoIP database failed: %w", err)
+		}
+	}
+
+	if urls.geoSite != "" {
+		if err := updateOne(urls.geoSite, C.Path.GeoSite()); err != nil {
+			return fmt.Errorf("update GeoSite database failed: %w", err)
+		}
+	}
+
+	if urls.asn != "" {
+		if err := updateOne(urls.asn, C.Path.ASN()); err != nil {
+			return fmt.Errorf("update ASN database failed: %w", err)
+		}
+	}
+
+	log.Infoln("[GEO] databases updated")
+	return nil
+}
+
+func updateOne(url, dst string) error {
+	tmp := dst + ".tmp"
+	defer os.Remove(tmp)
+
+	if err := downloadFile(url, tmp); err != nil {
+		return err
+	}
+
+	if err := G.Verify(tmp); err != nil {
+		return fmt.Errorf("verify %s failed: %w", tmp, err)
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+func downloadFile(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s downloading %s", resp.Status, url)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("empty response downloading %s", url)
+	}
+
+	return nil
+}
@@ -1,12 +1,16 @@
 package executor
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/netip"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,11 +27,14 @@ import (
 	"github.com/metacubex/mihomo/component/resolver"
 	SNI "github.com/metacubex/mihomo/component/sniffer"
 	"github.com/metacubex/mihomo/component/trie"
+	"github.com/metacubex/mihomo/component/updater"
 	"github.com/metacubex/mihomo/config"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/constant/features"
 	"github.com/metacubex/mihomo/constant/provider"
+	snifferType "github.com/metacubex/mihomo/constant/sniffer"
 	"github.com/metacubex/mihomo/dns"
+	"github.com/metacubex/mihomo/hub/route"
 	"github.com/metacubex/mihomo/listener"
 	authStore "github.com/metacubex/mihomo/listener/auth"
 	LC "github.com/metacubex/mihomo/listener/config"
@@ -76,11 +83,158 @@ func ParseWithBytes(buf []byte) (*config.Config, error) {
 	return config.Parse(buf)
 }
 
-// ApplyConfig dispatch configure to all parts
+// rollback is a closure that undoes one already-applied step of Reload,
+// restoring the live state it captured before the step ran.
+type rollback func()
+
+// pendingState accumulates rollback closures as Reload mutates live state,
+// so that a failure partway through can unwind everything applied so far
+// instead of leaving the process half-configured.
+type pendingState struct {
+	rollbacks []rollback
+}
+
+func (p *pendingState) record(r rollback) {
+	p.rollbacks = append(p.rollbacks, r)
+}
+
+func (p *pendingState) unwind() {
+	for i := len(p.rollbacks) - 1; i >= 0; i-- {
+		p.rollbacks[i]()
+	}
+}
+
+// configDigest hashes the JSON encoding of v so Reload can tell whether the
+// slice of config that feeds one subsystem actually changed between two
+// applies, instead of always tearing the subsystem down and rebuilding it.
+// ok is false if v couldn't be marshaled, in which case the caller must
+// treat the subsystem as changed (never skip a rebuild it can't prove is a
+// no-op).
+func configDigest(v any) (digest string, ok bool) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// unchanged reports whether prev and next hash identically. It only ever
+// returns true when both hashed cleanly, so a marshal failure on either side
+// conservatively falls through to "changed".
+func unchanged(prev, next any) bool {
+	prevDigest, prevOK := configDigest(prev)
+	nextDigest, nextOK := configDigest(next)
+	return prevOK && nextOK && prevDigest == nextDigest
+}
+
+// dnsDigestKey is the slice of config that actually feeds updateDNS; two
+// configs that agree here produce an identical resolver/DNS server, so the
+// live one can be reused instead of recreated. Hosts is deliberately not
+// part of it: trie.DomainTrie has no exported fields, so json.Marshal can't
+// tell two different hosts tries apart (they'd both digest as "{}") -
+// unchanged's caller compares Hosts by pointer instead.
+type dnsDigestKey struct {
+	DNS  *config.DNS
+	IPv6 bool
+}
+
+// listenersDigestKey is the slice of config that actually feeds
+// updateListeners; two configs that agree here bind the same sockets, so the
+// live listeners can be reused instead of recreated.
+type listenersDigestKey struct {
+	AllowLan          bool
+	SkipAuthPrefixes  []string
+	BindAddress       string
+	Port              int
+	SocksPort         int
+	RedirPort         int
+	AutoRedir         string
+	TProxyPort        int
+	MixedPort         int
+	ShadowSocksConfig string
+	VmessConfig       string
+	TuicServer        LC.TuicServer
+	Listeners         map[string]C.InboundListener
+}
+
+func newListenersDigestKey(general *config.General, listeners map[string]C.InboundListener) listenersDigestKey {
+	return listenersDigestKey{
+		AllowLan:          general.AllowLan,
+		SkipAuthPrefixes:  general.SkipAuthPrefixes,
+		BindAddress:       general.BindAddress,
+		Port:              general.Port,
+		SocksPort:         general.SocksPort,
+		RedirPort:         general.RedirPort,
+		AutoRedir:         general.EBpf.AutoRedir,
+		TProxyPort:        general.TProxyPort,
+		MixedPort:         general.MixedPort,
+		ShadowSocksConfig: general.ShadowSocksConfig,
+		VmessConfig:       general.VmessConfig,
+		TuicServer:        general.TuicServer,
+		Listeners:         listeners,
+	}
+}
+
+// lastAppliedCfg is the config behind the live state, i.e. the last one
+// Reload applied successfully. Rollback closures use it to restore the
+// subsystem they touched to its real prior state, not merely tear it down;
+// the digest helpers above use it to skip rebuilding a subsystem whose slice
+// of config didn't change at all.
+// Guarded by mux.
+var lastAppliedCfg *config.Config
+
+// ApplyConfig dispatch configure to all parts. It never returns an error to
+// the caller; use Reload if the caller needs to observe and react to a
+// failed apply.
 func ApplyConfig(cfg *config.Config, force bool) {
+	if err := Reload(cfg, force); err != nil {
+		log.Errorln("[CONFIG] apply failed: %s", err.Error())
+	}
+}
+
+// Reload dispatches configure to all parts, same as ApplyConfig, but returns
+// the first error encountered instead of only logging it.
+//
+// DNS, listeners and tun are diffed against lastAppliedCfg: a subsystem
+// whose digest did not change is left running, reusing the live resolver or
+// listener sockets, instead of being torn down and rebuilt on every reload.
+// DNS, listeners and iptables record a rollback closure as they are applied
+// that restores lastAppliedCfg's real prior state (not just a teardown), so
+// a later failure (e.g. iptables) or a recovered panic unwinds those three.
+// New objects are not staged ahead of the apply: updateDNS builds and
+// installs the new resolver in one step. The steps before DNS (users,
+// proxies, rules, sniffer, hosts, general settings, geo updater, external
+// controller, NTP) and after iptables (tun, experimental settings, tunnels)
+// change live state directly and are not rolled back on failure. The
+// tunnel - suspended for the duration of the apply - is always resumed
+// before Reload returns, whether or not the apply succeeded.
+func Reload(cfg *config.Config, force bool) (err error) {
 	mux.Lock()
 	defer mux.Unlock()
 
+	prev := lastAppliedCfg
+	pending := &pendingState{}
+	defer func() {
+		if r := recover(); r != nil {
+			pending.unwind()
+			err = fmt.Errorf("panic while applying config: %v", r)
+		} else if err != nil {
+			pending.unwind()
+		}
+
+		if err != nil {
+			// the apply failed and was rolled back; resume the tunnel on the
+			// restored state instead of leaving traffic suspended
+			tunnel.OnInnerLoading()
+			tunnel.OnRunning()
+			return
+		}
+
+		lastAppliedCfg = cfg
+		tunnel.OnConfigApplied(cfg)
+	}()
+
 	tunnel.OnSuspend()
 
 	ca.ResetCertificate()
@@ -94,13 +248,34 @@ func ApplyConfig(cfg *config.Config, force bool) {
 	updateProxies(cfg.Proxies, cfg.Providers)
 	updateRules(cfg.Rules, cfg.SubRules, cfg.RuleProviders)
 	updateSniffer(cfg.Sniffer)
-	updateHosts(cfg.Hosts)
+	updateHosts(cfg.Hosts, cfg.General.HostsMappingFile)
 	updateGeneral(cfg.General)
+	updateGeoAutoUpdate(cfg)
+	updateExternalController(cfg.General)
 	updateNTP(cfg.NTP)
-	updateDNS(cfg.DNS, cfg.RuleProviders, cfg.General.IPv6)
-	updateListeners(cfg.General, cfg.Listeners, force)
-	updateIPTables(cfg)
-	updateTun(cfg.General)
+
+	newDNSKey := dnsDigestKey{DNS: cfg.DNS, IPv6: cfg.General.IPv6}
+	hostsUnchanged := prev != nil && prev.Hosts == cfg.Hosts
+	if hostsUnchanged && unchanged(dnsDigestKey{DNS: prev.DNS, IPv6: prev.General.IPv6}, newDNSKey) {
+		log.Infoln("[CONFIG] DNS config unchanged, reusing live resolver")
+	} else if err = updateDNSWithRollback(pending, prev, cfg.DNS, cfg.Hosts, cfg.RuleProviders, cfg.General.IPv6); err != nil {
+		return fmt.Errorf("apply DNS config: %w", err)
+	}
+
+	newListenersKey := newListenersDigestKey(cfg.General, cfg.Listeners)
+	if prev != nil && unchanged(newListenersDigestKey(prev.General, prev.Listeners), newListenersKey) {
+		log.Infoln("[CONFIG] listeners config unchanged, reusing live sockets")
+	} else {
+		updateListenersWithRollback(pending, prev, cfg.General, cfg.Listeners, force)
+	}
+
+	if err = updateIPTablesWithRollback(pending, prev, cfg); err != nil {
+		return fmt.Errorf("apply iptables config: %w", err)
+	}
+
+	if prev == nil || !unchanged(prev.General.Tun, cfg.General.Tun) {
+		updateTun(cfg.General)
+	}
 	updateExperimental(cfg)
 	updateTunnels(cfg.Tunnels)
 
@@ -115,6 +290,8 @@ func ApplyConfig(cfg *config.Config, force bool) {
 	hcCompatibleProvider(cfg.Providers)
 
 	log.SetLevel(cfg.General.LogLevel)
+
+	return nil
 }
 
 func initInnerTcp() {
@@ -182,6 +359,21 @@ func updateListeners(general *config.General, listeners map[string]C.InboundList
 	listener.ReCreateTuic(general.TuicServer, tunnel.Tunnel)
 }
 
+// updateListenersWithRollback behaves like updateListeners, but records a
+// closure that recreates prev's listeners on pending, so a later failing
+// step (e.g. iptables) doesn't leave sockets bound to a config that never
+// fully applied. If there is no prior applied config, there is nothing to
+// restore the listeners to, so no rollback is recorded.
+func updateListenersWithRollback(pending *pendingState, prev *config.Config, general *config.General, listeners map[string]C.InboundListener, force bool) {
+	if prev != nil {
+		pending.record(func() {
+			updateListeners(prev.General, prev.Listeners, true)
+		})
+	}
+
+	updateListeners(general, listeners, force)
+}
+
 func updateExperimental(c *config.Config) {
 	if c.Experimental.QUICGoDisableGSO {
 		_ = os.Setenv("QUIC_GO_DISABLE_GSO", strconv.FormatBool(true))
@@ -202,7 +394,16 @@ func updateNTP(c *config.NTP) {
 	}
 }
 
-func updateDNS(c *config.DNS, ruleProvider map[string]provider.RuleProvider, generalIPv6 bool) {
+// updateDNS rebuilds the resolver/enhancer/local-server trio from c, wiring
+// in hosts - the same hosts trie updateHosts installs as resolver.DefaultHosts
+// - as dns.Config.Hosts, rather than c.Hosts, so the resolver/enhancer's own
+// hosts-trie check sees every entry's multi-address/CNAME/TTL data and not
+// just whatever DNS-block-local copy config parsing produced. A hit
+// synthesizes an answer with its own TTL (resolver.HostValue.ToMsg); a hosts
+// entry that's still a CNAME outside the trie falls through to be resolved
+// against the configured nameservers and cached normally, same as any other
+// answer.
+func updateDNS(c *config.DNS, hosts *trie.DomainTrie[resolver.HostValue], ruleProvider map[string]provider.RuleProvider, generalIPv6 bool) {
 	if !c.Enable {
 		resolver.DefaultResolver = nil
 		resolver.DefaultHostMapper = nil
@@ -217,7 +418,7 @@ func updateDNS(c *config.DNS, ruleProvider map[string]provider.RuleProvider, gen
 		IPv6Timeout:  c.IPv6Timeout,
 		EnhancedMode: c.EnhancedMode,
 		Pool:         c.FakeIPRange,
-		Hosts:        c.Hosts,
+		Hosts:        hosts,
 		FallbackFilter: dns.FallbackFilter{
 			GeoIP:     c.FallbackFilter.GeoIP,
 			GeoIPCode: c.FallbackFilter.GeoIPCode,
@@ -252,10 +453,109 @@ func updateDNS(c *config.DNS, ruleProvider map[string]provider.RuleProvider, gen
 	dns.ReCreateServer(c.Listen, r, m)
 }
 
-func updateHosts(tree *trie.DomainTrie[resolver.HostValue]) {
+// updateDNSWithRollback behaves like updateDNS, but records a closure that
+// re-applies prev's DNS config on pending - restoring the resolver/
+// host-mapper/local-server pointers AND re-running dns.ReCreateServer so the
+// live DNS listener is actually rebound to the old config, not just pointing
+// its resolver fields at stale state. If there is no prior applied config
+// (this is the first apply), the rollback just tears the DNS server down.
+func updateDNSWithRollback(pending *pendingState, prev *config.Config, c *config.DNS, hosts *trie.DomainTrie[resolver.HostValue], ruleProvider map[string]provider.RuleProvider, generalIPv6 bool) error {
+	pending.record(func() {
+		if prev == nil {
+			resolver.DefaultResolver = nil
+			resolver.DefaultHostMapper = nil
+			resolver.DefaultLocalServer = nil
+			dns.ReCreateServer("", nil, nil)
+			return
+		}
+		updateDNS(prev.DNS, prev.Hosts, prev.RuleProviders, prev.General.IPv6)
+	})
+
+	updateDNS(c, hosts, ruleProvider, generalIPv6)
+	return nil
+}
+
+// updateHosts installs the YAML `hosts:` map, merged with any entries loaded
+// from hostsMappingFile (an /etc/hosts-format file, re-read on every config
+// apply so edits take effect without a restart). YAML entries take
+// precedence over the mapping file on conflict.
+// Each resolver.HostValue in tree may carry multiple A/AAAA addresses
+// (one picked at random per call via HostValue.RandIP), a per-entry TTL override, or
+// an unresolved CNAME target (HostValue.IsDomain); resolver.Hosts.Search
+// flattens CNAME chains that stay within the hosts trie itself (cycle-safe,
+// max depth 8), while a CNAME pointing outside the trie is expanded against
+// the configured nameservers by the DNS enhancer before being cached, same
+// as any other upstream answer.
+func updateHosts(tree *trie.DomainTrie[resolver.HostValue], hostsMappingFile string) {
+	if hostsMappingFile != "" {
+		if err := mergeHostsMappingFile(tree, hostsMappingFile); err != nil {
+			log.Warnln("load hosts-mapping-file %s failed: %s", hostsMappingFile, err.Error())
+		}
+	}
+
 	resolver.DefaultHosts = resolver.NewHosts(tree)
 }
 
+// mergeHostsMappingFile parses an /etc/hosts-format file, collecting every
+// address listed for a given host (a host may legitimately repeat across
+// lines, e.g. one for its A record and one for its AAAA record) before
+// inserting it into tree, skipping any domain the YAML `hosts:` map already
+// defined so YAML-defined hosts win on conflict.
+func mergeHostsMappingFile(tree *trie.DomainTrie[resolver.HostValue], path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	yamlDefined := make(map[string]bool)
+	addrs := make(map[string][]netip.Addr)
+	var order []string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			continue
+		}
+
+		for _, raw := range fields[1:] {
+			host := strings.ToLower(strings.TrimSuffix(raw, "."))
+			if _, seen := addrs[host]; !seen {
+				if tree.Search(host) != nil {
+					yamlDefined[host] = true
+				}
+				order = append(order, host)
+			}
+			addrs[host] = append(addrs[host], ip)
+		}
+	}
+
+	for _, host := range order {
+		if yamlDefined[host] {
+			continue
+		}
+		// DomainTrie.Insert/Search key on dot-separated labels; a
+		// single-label name like "localhost" is a valid (if degenerate) one
+		// and inserts fine, but we still log and skip rather than aborting
+		// the whole merge if a given entry is ever rejected (e.g. an invalid
+		// character).
+		if err := tree.Insert(host, resolver.NewHostValue(addrs[host])); err != nil {
+			log.Warnln("insert hosts-mapping-file entry %s failed: %s", host, err.Error())
+		}
+	}
+
+	return nil
+}
+
 func updateProxies(proxies map[string]C.Proxy, providers map[string]provider.ProxyProvider) {
 	tunnel.UpdateProxies(proxies, providers)
 }
@@ -348,10 +648,32 @@ func updateTun(general *config.General) {
 	listener.ReCreateRedirToTun(general.Tun.RedirectToTun)
 }
 
+// sniffersToDispatcherConfig adapts the per-sniffer YAML entries (override
+// destination list plus force/skip flag, port range and source CIDR scope,
+// sniff timeout) into the component/sniffer.Config the dispatcher consumes.
+func sniffersToDispatcherConfig(sniffers map[snifferType.Type]config.SniffConfig) map[snifferType.Type]SNI.Config {
+	out := make(map[snifferType.Type]SNI.Config, len(sniffers))
+	for proto, c := range sniffers {
+		ports := make([]SNI.PortRange, 0, len(c.Ports))
+		for _, p := range c.Ports {
+			ports = append(ports, SNI.PortRange{Start: p.Start, End: p.End})
+		}
+
+		out[proto] = SNI.Config{
+			Ports:         ports,
+			SrcCIDRs:      c.SrcCIDRs,
+			Timeout:       c.SniffTimeout,
+			Override:      c.OverrideDestination,
+			OverrideForce: c.ForceOverride,
+		}
+	}
+	return out
+}
+
 func updateSniffer(sniffer *config.Sniffer) {
 	if sniffer.Enable {
 		dispatcher, err := SNI.NewSnifferDispatcher(
-			sniffer.Sniffers, sniffer.ForceDomain, sniffer.SkipDomain,
+			sniffersToDispatcherConfig(sniffer.Sniffers), sniffer.ForceDomain, sniffer.SkipDomain,
 			sniffer.ForceDnsMapping, sniffer.ParsePureIp,
 		)
 		if err != nil {
@@ -401,6 +723,50 @@ func updateGeneral(general *config.General) {
 	G.SetLoader(geodataLoader)
 }
 
+// updateGeoAutoUpdate (re)registers the background GeoIP/GeoSite/ASN updater
+// according to cfg.General.GeoAutoUpdate / GeoUpdateInterval, and repoints it
+// at the `geo-auto-update` section's download URLs (any left blank keeps the
+// URL already in effect, the built-in default until one has been set). On a
+// successful download it swaps
+// the geodata loader and rebinds existing GEOIP/GEOSITE rules without a full
+// config reparse. Called on every apply so toggling geo-auto-update off
+// actually stops the previously-started ticker instead of requiring a
+// restart.
+func updateGeoAutoUpdate(cfg *config.Config) {
+	interval := cfg.General.GeoUpdateInterval
+	if !cfg.General.GeoAutoUpdate {
+		interval = 0
+	}
+
+	updater.SetGeoURLs(cfg.General.GeoIPUrl, cfg.General.GeoSiteUrl, cfg.General.GeoAsnUrl)
+
+	updater.RegisterGeoUpdater(interval, func() {
+		G.SetLoader(cfg.General.GeodataLoader)
+		updateRules(cfg.Rules, cfg.SubRules, cfg.RuleProviders)
+		log.Infoln("[GEO] databases reloaded, rules rebound")
+	})
+}
+
+// lastAPIAddr/lastAPISecret are what route.Start was last called with,
+// guarding against rebinding its listener on every reload: Start always
+// closes and reopens the socket, which would otherwise log a spurious
+// "server stopped" error and briefly refuse connections on every apply, even
+// one that didn't touch ExternalController/Secret at all. Guarded by mux.
+var lastAPIAddr, lastAPISecret string
+
+// updateExternalController (re)mounts /configs/geo and /sniffer - added to
+// route.Mux - onto the RESTful API at general.ExternalController, rebinding
+// only when the address or secret actually changed from the last apply.
+func updateExternalController(general *config.General) {
+	if general.ExternalController == lastAPIAddr && general.Secret == lastAPISecret {
+		return
+	}
+
+	route.Start(general.ExternalController, general.Secret)
+	lastAPIAddr = general.ExternalController
+	lastAPISecret = general.Secret
+}
+
 func updateUsers(users []auth.AuthUser) {
 	authenticator := auth.NewAuthenticator(users)
 	authStore.SetAuthenticator(authenticator)
@@ -444,25 +810,39 @@ func patchSelectGroup(proxies map[string]C.Proxy) {
 	}
 }
 
-func updateIPTables(cfg *config.Config) {
+// updateIPTablesWithRollback behaves like updateIPTables, but records a
+// closure on pending that re-applies prev's iptables rules if a later step
+// of Reload fails, instead of merely clearing the rules this call set up. If
+// there is no prior applied config, there is nothing to restore, so the
+// rollback just cleans up.
+func updateIPTablesWithRollback(pending *pendingState, prev *config.Config, cfg *config.Config) error {
+	pending.record(func() {
+		if prev == nil {
+			tproxy.CleanupTProxyIPTables()
+			return
+		}
+		if err := updateIPTables(prev); err != nil {
+			log.Errorln("[IPTABLES] restoring previous iptables rules failed: %s", err.Error())
+		}
+	})
+
+	if err := updateIPTables(cfg); err != nil {
+		log.Errorln("[IPTABLES] setting iptables failed: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+func updateIPTables(cfg *config.Config) error {
 	tproxy.CleanupTProxyIPTables()
 
 	iptables := cfg.IPTables
 	if runtime.GOOS != "linux" || !iptables.Enable {
-		return
+		return nil
 	}
 
-	var err error
-	defer func() {
-		if err != nil {
-			log.Errorln("[IPTABLES] setting iptables failed: %s", err.Error())
-			os.Exit(2)
-		}
-	}()
-
 	if cfg.General.Tun.Enable {
-		err = fmt.Errorf("when tun is enabled, iptables cannot be set automatically")
-		return
+		return fmt.Errorf("when tun is enabled, iptables cannot be set automatically")
 	}
 
 	var (
@@ -473,19 +853,16 @@ func updateIPTables(cfg *config.Config) {
 	)
 
 	if tProxyPort == 0 {
-		err = fmt.Errorf("tproxy-port must be greater than zero")
-		return
+		return fmt.Errorf("tproxy-port must be greater than zero")
 	}
 
 	if !dnsCfg.Enable {
-		err = fmt.Errorf("DNS server must be enable")
-		return
+		return fmt.Errorf("DNS server must be enable")
 	}
 
 	dnsPort, err := netip.ParseAddrPort(dnsCfg.Listen)
 	if err != nil {
-		err = fmt.Errorf("DNS server must be correct")
-		return
+		return fmt.Errorf("DNS server must be correct")
 	}
 
 	if iptables.InboundInterface != "" {
@@ -496,12 +873,12 @@ func updateIPTables(cfg *config.Config) {
 		dialer.DefaultRoutingMark.Store(2158)
 	}
 
-	err = tproxy.SetTProxyIPTables(inboundInterface, bypass, uint16(tProxyPort), dnsPort.Port())
-	if err != nil {
-		return
+	if err = tproxy.SetTProxyIPTables(inboundInterface, bypass, uint16(tProxyPort), dnsPort.Port()); err != nil {
+		return err
 	}
 
 	log.Infoln("[IPTABLES] Setting iptables completed")
+	return nil
 }
 
 func Shutdown() {
@@ -0,0 +1,21 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/metacubex/mihomo/component/updater"
+
+	"github.com/go-chi/render"
+)
+
+// updateGeoDatabases handles POST /configs/geo, synchronously refreshing the
+// GeoIP/GeoSite/ASN databases. Registered on Mux.
+func updateGeoDatabases(w http.ResponseWriter, r *http.Request) {
+	if err := updater.UpdateGeoDatabases(); err != nil {
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+
+	render.NoContent(w, r)
+}
@@ -0,0 +1,92 @@
+package route
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/metacubex/mihomo/log"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Mux is the router for the RESTful endpoints added in this series. It is
+// mounted under the application's existing RESTful API root alongside
+// /configs, /proxies, etc.; Start below serves it directly when no such root
+// has wired it in yet, so /configs/geo and /sniffer are reachable either way.
+var Mux = newMux()
+
+func newMux() *chi.Mux {
+	r := chi.NewRouter()
+	r.Post("/configs/geo", updateGeoDatabases)
+	r.Get("/sniffer", getSnifferStats)
+	return r
+}
+
+// Mount registers Mux's routes onto root, for callers that already have a
+// live RESTful API router (e.g. the application's main hub/route composition)
+// and just need /configs/geo and /sniffer added to it.
+func Mount(root chi.Router) {
+	root.Post("/configs/geo", updateGeoDatabases)
+	root.Get("/sniffer", getSnifferStats)
+}
+
+// authenticated wraps Mux with bearer-secret auth, matching the rest of the
+// RESTful API: a configured secret requires a matching "Authorization:
+// Bearer <secret>" header, empty requires nothing.
+func authenticated(secret string) http.Handler {
+	if secret == "" {
+		return Mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		Mux.ServeHTTP(w, r)
+	})
+}
+
+// listener is the currently bound Start listener, if any. Guarded by mux so
+// Start is safe to call on every config apply, the same way
+// updater.RegisterGeoUpdater is safe to call on every apply.
+var (
+	mux      sync.Mutex
+	listener net.Listener
+)
+
+// Start (re)serves /configs/geo and /sniffer on addr with bearer-secret auth.
+// It exists so these endpoints are reachable even before the application's
+// main RESTful API server (outside this package) mounts them via Mount; once
+// it does, callers should stop calling Start to avoid serving the same
+// routes twice. It is safe to call on every config apply: a previously bound
+// listener is always closed first, so changing addr rebinds instead of
+// leaking the old socket, and changing secret alone takes effect immediately
+// even with addr unchanged.
+func Start(addr, secret string) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if listener != nil {
+		listener.Close()
+		listener = nil
+	}
+
+	if addr == "" {
+		return
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Errorln("[API] sniffer/geo listener on %s: %s", addr, err.Error())
+		return
+	}
+	listener = l
+
+	go func() {
+		if err := http.Serve(l, authenticated(secret)); err != nil {
+			log.Errorln("[API] sniffer/geo server on %s stopped: %s", addr, err.Error())
+		}
+	}()
+}
@@ -0,0 +1,21 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/metacubex/mihomo/tunnel"
+
+	"github.com/go-chi/render"
+)
+
+// getSnifferStats handles GET /sniffer, returning realtime sniffed/missed
+// counters per sniffer type from the active dispatcher. Registered on Mux.
+func getSnifferStats(w http.ResponseWriter, r *http.Request) {
+	dispatcher := tunnel.SnifferDispatcher()
+	if dispatcher == nil || !dispatcher.Enable() {
+		render.JSON(w, r, render.M{})
+		return
+	}
+
+	render.JSON(w, r, dispatcher.Stats())
+}